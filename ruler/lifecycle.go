@@ -0,0 +1,142 @@
+package ruler
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+)
+
+// ringAutoForgetUnhealthyPeriods is the number of consecutive heartbeat
+// timeout periods an instance can be missing from the ring before it is
+// automatically forgotten. This mirrors the constant used by dskit's other
+// ring-backed components (distributors, compactors).
+const ringAutoForgetUnhealthyPeriods = 10
+
+// RingConfig holds the configuration for the ruler's hash ring. KVStore.Store
+// may be any backend kv.NewClient supports, including "memberlist" for
+// gossip-based deployments that don't want to run a consul/etcd cluster; see
+// ApplyMemberlistDefaults for the probe tuning the ruler ring expects.
+type RingConfig struct {
+	KVStore kv.Config `yaml:"kvstore"`
+
+	HeartbeatPeriod  time.Duration `yaml:"heartbeat_period"`
+	HeartbeatTimeout time.Duration `yaml:"heartbeat_timeout"`
+
+	// Instance details.
+	InstanceID   string `yaml:"-"`
+	InstanceAddr string `yaml:"instance_addr"`
+	InstancePort int    `yaml:"-"`
+
+	NumTokens int `yaml:"num_tokens"`
+
+	// TokensFilePath, when set, makes the lifecycler persist its tokens to
+	// this path and reuse them on the next restart instead of generating a
+	// fresh set, so a restarting ruler doesn't churn rule group ownership
+	// across the rest of the fleet.
+	TokensFilePath string `yaml:"tokens_file_path"`
+
+	// ObservePeriod, when non-zero, makes the lifecycler wait after
+	// registering until its tokens have stayed unchanged in the ring for this
+	// period before it finishes starting. The instance registers directly in
+	// ACTIVE either way. It's mainly useful in tests and gossip-based rings.
+	ObservePeriod time.Duration `yaml:"-"`
+}
+
+// RegisterFlags registers the ruler ring flags.
+func (cfg *RingConfig) RegisterFlags(f *flag.FlagSet) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	cfg.KVStore.RegisterFlagsWithPrefix("ruler.ring.", "collectors/", f)
+	f.DurationVar(&cfg.HeartbeatPeriod, "ruler.ring.heartbeat-period", 5*time.Second, "Period at which the ruler sends heartbeats to the ring.")
+	f.DurationVar(&cfg.HeartbeatTimeout, "ruler.ring.heartbeat-timeout", time.Minute, "The heartbeat timeout after which a ruler is considered unhealthy. A ruler with no heartbeat for ringAutoForgetUnhealthyPeriods times this timeout is forgotten.")
+	f.StringVar(&cfg.InstanceID, "ruler.ring.instance-id", hostname, "Instance ID to register in the ring.")
+	f.StringVar(&cfg.InstanceAddr, "ruler.ring.instance-addr", "", "IP address to advertise in the ring.")
+	f.IntVar(&cfg.InstancePort, "ruler.ring.instance-port", 0, "Port to advertise in the ring.")
+	f.IntVar(&cfg.NumTokens, "ruler.ring.num-tokens", 128, "Number of tokens for the ruler ring.")
+	f.StringVar(&cfg.TokensFilePath, "ruler.ring.tokens-file-path", "", "Path at which to persist ring tokens so they survive a restart. If empty, tokens are regenerated on every startup.")
+}
+
+// ToBasicLifecyclerConfig converts the ring config into the form expected by
+// ring.NewBasicLifecycler.
+func (cfg *RingConfig) ToBasicLifecyclerConfig() ring.BasicLifecyclerConfig {
+	return ring.BasicLifecyclerConfig{
+		ID:                  cfg.InstanceID,
+		Addr:                fmt.Sprintf("%s:%d", cfg.InstanceAddr, cfg.InstancePort),
+		HeartbeatPeriod:     cfg.HeartbeatPeriod,
+		HeartbeatTimeout:    cfg.HeartbeatTimeout,
+		TokensObservePeriod: cfg.ObservePeriod,
+		NumTokens:           cfg.NumTokens,
+	}
+}
+
+// ToRingConfig converts the ring config into a ring.Config suitable for
+// building a read-only ring.Ring used to look up rule group ownership.
+func (cfg *RingConfig) ToRingConfig() ring.Config {
+	rc := ring.Config{}
+	rc.KVStore = cfg.KVStore
+	rc.HeartbeatTimeout = cfg.HeartbeatTimeout
+	rc.ReplicationFactor = 1
+	return rc
+}
+
+// buildLifecyclerDelegate assembles the delegate chain used by the ruler's
+// BasicLifecycler: instances register themselves (reusing tokens from
+// TokensFilePath when one is configured), leave the ring cleanly on graceful
+// shutdown, and unhealthy instances that have been missing for
+// ringAutoForgetUnhealthyPeriods heartbeat timeouts are forgotten
+// automatically so operators don't have to intervene by hand.
+func buildLifecyclerDelegate(cfg RingConfig, logger log.Logger) ring.BasicLifecyclerDelegate {
+	delegate := ring.BasicLifecyclerDelegate(ring.NewInstanceRegisterDelegate(ring.ACTIVE, cfg.NumTokens))
+	delegate = ring.NewLeaveOnStoppingDelegate(delegate, logger)
+	delegate = ring.NewTokensPersistencyDelegate(cfg.TokensFilePath, ring.ACTIVE, delegate, logger)
+	delegate = ring.NewAutoForgetDelegate(ringAutoForgetUnhealthyPeriods*cfg.HeartbeatTimeout, delegate, logger)
+	return delegate
+}
+
+// initRing builds the ruler's BasicLifecycler and read-only ring against the
+// given KV client and wires them into a subservices manager, but does not
+// start them; starting() is responsible for that.
+func (r *Ruler) initRing(ringStore kv.Client) error {
+	delegate := buildLifecyclerDelegate(r.cfg.Ring, r.logger)
+
+	lifecycler, err := ring.NewBasicLifecycler(r.cfg.Ring.ToBasicLifecyclerConfig(), "ruler", ring.RulerRingKey, ringStore, delegate, r.logger, r.reg)
+	if err != nil {
+		return err
+	}
+
+	readRing, err := ring.New(r.cfg.Ring.ToRingConfig(), "ruler", ring.RulerRingKey, r.logger, r.reg)
+	if err != nil {
+		return err
+	}
+
+	subservices, err := services.NewManager(lifecycler, readRing)
+	if err != nil {
+		return err
+	}
+
+	r.lifecycler = lifecycler
+	r.ring = readRing
+	r.subservices = subservices
+	r.subservicesWatcher = services.NewFailureWatcher()
+	r.subservicesWatcher.WatchManager(r.subservices)
+
+	return nil
+}
+
+// enableSharding bootstraps the ruler's ring components against ringStore.
+// It performs the same wiring starting() does when EnableSharding is true,
+// except that it lets callers supply their own KV client — which is how
+// tests attach an in-memory consul client instead of dialing a real backend.
+func enableSharding(r *Ruler, ringStore kv.Client) error {
+	return r.initRing(ringStore)
+}
@@ -21,7 +21,7 @@ import (
 func TestRulerShutdown(t *testing.T) {
 	ctx := context.Background()
 
-	config, cleanup := defaultRulerConfig(t, newMockRuleStore(mockRules))
+	config, cleanup := defaultRulerConfig(t)
 	defer cleanup()
 
 	r, rcleanup := newRuler(t, config)
@@ -57,7 +57,7 @@ func TestRuler_RingLifecyclerShouldAutoForgetUnhealthyInstances(t *testing.T) {
 	const heartbeatTimeout = time.Minute
 
 	ctx := context.Background()
-	config, cleanup := defaultRulerConfig(t, newMockRuleStore(mockRules))
+	config, cleanup := defaultRulerConfig(t)
 	defer cleanup()
 	r, rcleanup := newRuler(t, config)
 	defer rcleanup()
@@ -0,0 +1,30 @@
+package ruler
+
+import (
+	"time"
+
+	"github.com/grafana/dskit/kv/memberlist"
+)
+
+// Gossip-specific SWIM probe tuning for the ruler ring, applied by
+// ApplyMemberlistDefaults. These only govern how gossip members probe each
+// other; a dead ruler's ring entry is forgotten by AutoForgetDelegate based
+// on its last heartbeat timestamp (see buildLifecyclerDelegate), not on
+// these probes.
+const (
+	DefaultMemberlistProbeInterval = 5 * time.Second
+	DefaultMemberlistProbeTimeout  = 2 * time.Second
+)
+
+// ApplyMemberlistDefaults sets the ruler's recommended gossip probe cadence
+// on cfg, without overriding any value the operator has already set
+// explicitly. Call this before passing cfg to memberlist.NewKVInitService
+// when running the ruler ring over kv/memberlist.
+func ApplyMemberlistDefaults(cfg *memberlist.KVConfig) {
+	if cfg.ProbeInterval == 0 {
+		cfg.ProbeInterval = DefaultMemberlistProbeInterval
+	}
+	if cfg.ProbeTimeout == 0 {
+		cfg.ProbeTimeout = DefaultMemberlistProbeTimeout
+	}
+}
@@ -0,0 +1,120 @@
+package ruler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/kv/memberlist"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/testutil"
+)
+
+// newMemberlistKV starts a memberlist.KVInitService bound to an ephemeral
+// local port, optionally joining an existing gossip cluster through
+// joinAddrs.
+func newMemberlistKV(t *testing.T, joinAddrs []string) *memberlist.KVInitService {
+	t.Helper()
+
+	cfg := memberlist.KVConfig{}
+	cfg.TCPTransport.BindAddrs = []string{"127.0.0.1"}
+	cfg.TCPTransport.BindPort = 0
+	cfg.JoinMembers = joinAddrs
+	ApplyMemberlistDefaults(&cfg)
+
+	kvInit := memberlist.NewKVInitService(&cfg, log.NewNopLogger(), nil, prometheus.NewRegistry())
+	require.NoError(t, services.StartAndAwaitRunning(context.Background(), kvInit))
+	t.Cleanup(func() { _ = services.StopAndAwaitTerminated(context.Background(), kvInit) })
+
+	return kvInit
+}
+
+// TestRuler_MemberlistRing starts three rulers gossiping over memberlist
+// instead of consul, waits for their tokens to converge, kills one, and
+// asserts the remaining two auto-forget it within
+// ringAutoForgetUnhealthyPeriods*HeartbeatTimeout.
+func TestRuler_MemberlistRing(t *testing.T) {
+	const numRulers = 3
+	const heartbeatTimeout = 2 * time.Second
+	ctx := context.Background()
+
+	kvInits := make([]*memberlist.KVInitService, numRulers)
+	kvInits[0] = newMemberlistKV(t, nil)
+
+	addrOf := func(kvInit *memberlist.KVInitService) string {
+		return fmt.Sprintf("127.0.0.1:%d", kvInit.GetListeningPort())
+	}
+
+	for i := 1; i < numRulers; i++ {
+		kvInits[i] = newMemberlistKV(t, []string{addrOf(kvInits[0])})
+	}
+
+	rulers := make([]*Ruler, numRulers)
+	ringStores := make([]kv.Client, numRulers)
+
+	for i := 0; i < numRulers; i++ {
+		config, cleanup := defaultRulerConfig(t)
+		t.Cleanup(cleanup)
+		config.Ring.InstanceID = fmt.Sprintf("ruler-%d", i)
+		config.Ring.InstanceAddr = fmt.Sprintf("127.0.0.%d", i+1)
+		config.Ring.HeartbeatPeriod = 100 * time.Millisecond
+		config.Ring.HeartbeatTimeout = heartbeatTimeout
+		config.Ring.KVStore.Store = "memberlist"
+		config.EnableSharding = true
+
+		ringStore, err := kv.NewClient(kv.Config{
+			Store:       "memberlist",
+			StoreConfig: kv.StoreConfig{MemberlistKV: kvInits[i].GetMemberlistKV},
+		}, ring.GetCodec(), nil, log.NewNopLogger())
+		require.NoError(t, err)
+
+		r, rcleanup := newRuler(t, config)
+		t.Cleanup(rcleanup)
+
+		require.NoError(t, enableSharding(r, ringStore))
+		require.NoError(t, services.StartAndAwaitRunning(ctx, r))
+		t.Cleanup(func() { _ = services.StopAndAwaitTerminated(context.Background(), r) })
+
+		rulers[i] = r
+		ringStores[i] = ringStore
+	}
+
+	// Wait for gossip to converge: every node's view of the ring should show
+	// all three instances.
+	for _, store := range ringStores {
+		store := store
+		testutil.Poll(t, 5*time.Second, numRulers, func() interface{} {
+			d, err := store.Get(ctx, ring.RulerRingKey)
+			if err != nil {
+				return 0
+			}
+			return len(ring.GetOrCreateRingDesc(d).Ingesters)
+		})
+	}
+
+	// Simulate killing a ruler outright (as opposed to a graceful shutdown,
+	// which would just leave the ring cleanly): tear down its gossip agent
+	// without stopping its lifecycler, so its last-known ring entry goes
+	// stale instead of being removed.
+	victim := rulers[0]
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, kvInits[0]))
+
+	for _, store := range ringStores[1:] {
+		store := store
+		testutil.Poll(t, ringAutoForgetUnhealthyPeriods*heartbeatTimeout+5*time.Second, false, func() interface{} {
+			d, err := store.Get(ctx, ring.RulerRingKey)
+			if err != nil {
+				return true
+			}
+			_, ok := ring.GetOrCreateRingDesc(d).Ingesters[victim.cfg.Ring.InstanceID]
+			return ok
+		})
+	}
+}
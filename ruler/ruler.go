@@ -0,0 +1,258 @@
+package ruler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/dskit/kv"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+)
+
+// RuleGroup is the minimal representation of a rule group the ruler needs in
+// order to decide which instance is responsible for evaluating it. The rule
+// expressions themselves are owned by the RuleStore.
+type RuleGroup struct {
+	User      string
+	Namespace string
+	Name      string
+}
+
+// RuleStore is the interface the ruler uses to discover the rule groups that
+// exist across all tenants. It is up to the ruler to decide, based on the
+// ring, which of the returned groups it is responsible for evaluating.
+type RuleStore interface {
+	ListAllRules(ctx context.Context) (map[string][]*RuleGroup, error)
+}
+
+// RulerConfig configures a Ruler.
+type RulerConfig struct {
+	EnableSharding bool       `yaml:"enable_sharding"`
+	Ring           RingConfig `yaml:"ring"`
+
+	// ShardingStrategy is either ShardingStrategyDefault or
+	// ShardingStrategyShuffle. It only has an effect when EnableSharding is
+	// true.
+	ShardingStrategy string `yaml:"sharding_strategy"`
+
+	// RulerTenantShardSize is the default number of rulers each tenant's
+	// rule groups are sharded across under ShardingStrategyShuffle. A
+	// Limits implementation passed to NewRuler can override this per
+	// tenant. Zero (or a value >= the ring size) means "the whole ring".
+	RulerTenantShardSize int `yaml:"ruler_tenant_shard_size"`
+
+	// RulePollInterval is how often the ruler re-polls the RuleStore for
+	// changes to the set of rule groups it should be evaluating.
+	RulePollInterval time.Duration `yaml:"rule_poll_interval"`
+}
+
+// RegisterFlags registers the ruler flags.
+func (cfg *RulerConfig) RegisterFlags(f *flag.FlagSet) {
+	cfg.Ring.RegisterFlags(f)
+	f.BoolVar(&cfg.EnableSharding, "ruler.enable-sharding", false, "Distribute rule group evaluation between rulers using the ring.")
+	f.StringVar(&cfg.ShardingStrategy, "ruler.sharding-strategy", ShardingStrategyDefault, "The sharding strategy to use. Supported values are: default, shuffle-sharding.")
+	f.IntVar(&cfg.RulerTenantShardSize, "ruler.tenant-shard-size", 0, "The default tenant's shard size when ShardingStrategyShuffle is used. 0 disables shuffle sharding and uses the whole ring.")
+	f.DurationVar(&cfg.RulePollInterval, "ruler.poll-interval", time.Minute, "How frequently to poll the rule store for changes.")
+}
+
+// Ruler evaluates rule groups, sharding the work across a fleet of rulers via
+// a hash ring when EnableSharding is set.
+type Ruler struct {
+	services.Service
+
+	cfg    RulerConfig
+	store  RuleStore
+	limits Limits
+	logger log.Logger
+	reg    prometheus.Registerer
+
+	lifecycler *ring.BasicLifecycler
+	ring       *ring.Ring
+
+	subservices        *services.Manager
+	subservicesWatcher *services.FailureWatcher
+
+	// mu guards owned, the set of rule groups, keyed by user, that this
+	// instance is currently responsible for evaluating.
+	mu    sync.RWMutex
+	owned map[string][]*RuleGroup
+}
+
+// NewRuler creates a new Ruler. limits may be nil, in which case every
+// tenant uses cfg.RulerTenantShardSize for shuffle sharding.
+func NewRuler(cfg RulerConfig, store RuleStore, limits Limits, logger log.Logger, reg prometheus.Registerer) (*Ruler, error) {
+	r := &Ruler{
+		cfg:    cfg,
+		store:  store,
+		limits: limits,
+		logger: logger,
+		reg:    reg,
+	}
+
+	r.Service = services.NewBasicService(r.starting, r.running, r.stopping)
+	return r, nil
+}
+
+// OwnedRuleGroups returns the rule groups this instance is currently
+// responsible for evaluating for userID, as of the last successful sync.
+func (r *Ruler) OwnedRuleGroups(userID string) []*RuleGroup {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.owned[userID]
+}
+
+// ruleStoreOpener is implemented by RuleStores that need to do work (dial a
+// backend, check permissions, ...) before they can be listed. It's optional:
+// stores that don't need it simply don't implement it.
+type ruleStoreOpener interface {
+	Open(ctx context.Context) error
+}
+
+// starting wires up the ring (when sharding is enabled) and starts all the
+// ruler's sub-services.
+//
+// If any phase below fails, the lifecycler must not be left registered in
+// the ring: a ruler that dies partway through startup should not linger
+// there as a ghost ACTIVE or LEAVING entry that keeps receiving shard
+// assignments nobody is evaluating. rollbackOnFailure, deferred first thing,
+// guarantees that.
+func (r *Ruler) starting(ctx context.Context) (err error) {
+	if !r.cfg.EnableSharding {
+		return nil
+	}
+
+	defer r.rollbackOnFailure(&err)
+
+	if opener, ok := r.store.(ruleStoreOpener); ok {
+		if err := opener.Open(ctx); err != nil {
+			return fmt.Errorf("failed to open rule store: %w", err)
+		}
+	}
+
+	// If the ring components haven't already been set up (e.g. by a test
+	// using a custom KV client), build them against the configured backend.
+	if r.lifecycler == nil {
+		kvClient, err := kv.NewClient(r.cfg.Ring.KVStore, ring.GetCodec(), r.reg, r.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create ruler ring KV client: %w", err)
+		}
+
+		if err := r.initRing(kvClient); err != nil {
+			return fmt.Errorf("failed to initialize ruler ring: %w", err)
+		}
+	}
+
+	if err := services.StartAndAwaitRunning(ctx, r.subservices); err != nil {
+		return fmt.Errorf("failed to start ruler subservices: %w", err)
+	}
+
+	if err := r.syncRules(ctx); err != nil {
+		return fmt.Errorf("failed initial rule group sync: %w", err)
+	}
+
+	return nil
+}
+
+// rollbackOnFailure unconditionally stops the ring subservices manager if
+// *err is non-nil, so a failed starting() never leaves a stuck entry in the
+// ring KV, nor a leaked read-only ring poller and failure watcher running
+// with nothing left to stop them. services.NewBasicService never calls
+// stopping() when starting() fails, so this is the only place that can
+// unwind ring subservices that already reached Running — stopping the
+// manager as a whole (rather than just r.lifecycler) still triggers
+// LeaveOnStoppingDelegate, since the lifecycler is a member of it. It's a
+// no-op when the subservices manager was never created.
+func (r *Ruler) rollbackOnFailure(err *error) {
+	if *err == nil || r.subservices == nil {
+		return
+	}
+
+	level.Error(r.logger).Log("msg", "ruler failed to start, rolling back ring subservices", "err", *err)
+	if stopErr := services.StopAndAwaitTerminated(context.Background(), r.subservices); stopErr != nil {
+		level.Error(r.logger).Log("msg", "failed to stop ring subservices during startup rollback", "err", stopErr)
+	}
+}
+
+// running is the ruler's main loop: it periodically re-syncs rule groups from
+// the RuleStore and watches its sub-services for unexpected failures.
+func (r *Ruler) running(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.RulePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.syncRules(ctx); err != nil {
+				level.Warn(r.logger).Log("msg", "failed to sync rule groups", "err", err)
+			}
+		case err := <-r.subservicesWatcherChan():
+			return fmt.Errorf("ruler subservice failed: %w", err)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// stopping gracefully shuts down the ruler, unregistering from the ring.
+func (r *Ruler) stopping(_ error) error {
+	if r.subservices != nil {
+		return services.StopAndAwaitTerminated(context.Background(), r.subservices)
+	}
+	return nil
+}
+
+// subservicesWatcherChan returns the failure channel of the subservices
+// watcher, or a nil channel (which blocks forever) when sharding is disabled.
+func (r *Ruler) subservicesWatcherChan() <-chan error {
+	if r.subservicesWatcher == nil {
+		return nil
+	}
+	return r.subservicesWatcher.Chan()
+}
+
+// syncRules re-reads the rule store and recomputes the set of rule groups
+// this instance is responsible for evaluating. Ownership is re-derived from
+// the ring (or, under shuffle sharding, each tenant's subring) on every
+// call, so a ruler joining or leaving the fleet is picked up on the next
+// poll without any extra signalling.
+func (r *Ruler) syncRules(ctx context.Context) error {
+	allRules, err := r.store.ListAllRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list rule groups: %w", err)
+	}
+
+	if !r.cfg.EnableSharding {
+		r.mu.Lock()
+		r.owned = allRules
+		r.mu.Unlock()
+		return nil
+	}
+
+	owned := make(map[string][]*RuleGroup, len(allRules))
+	for userID, groups := range allRules {
+		subring := r.subringForUser(userID)
+
+		for _, g := range groups {
+			own, err := r.ownsRuleGroup(subring, g)
+			if err != nil {
+				return fmt.Errorf("failed to compute ownership for rule group %s/%s/%s: %w", g.User, g.Namespace, g.Name, err)
+			}
+			if own {
+				owned[userID] = append(owned[userID], g)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.owned = owned
+	r.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package ruler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+// mockRules is the fixed set of rule groups used by newMockRuleStore in
+// tests that don't care about the specific rules being evaluated, only about
+// ring membership and sharding behaviour.
+var mockRules = []*RuleGroup{
+	{User: "user1", Namespace: "namespace1", Name: "group1"},
+	{User: "user1", Namespace: "namespace2", Name: "group2"},
+	{User: "user2", Namespace: "namespace1", Name: "group1"},
+}
+
+// mockRuleStore is a RuleStore backed by an in-memory, fixed set of rule
+// groups, grouped by user. openErr and listErr, when set, make Open and
+// ListAllRules fail respectively, letting tests inject failures at specific
+// ruler startup phases.
+type mockRuleStore struct {
+	rules map[string][]*RuleGroup
+
+	openErr error
+	listErr error
+}
+
+func newMockRuleStore(groups []*RuleGroup) *mockRuleStore {
+	rules := map[string][]*RuleGroup{}
+	for _, g := range groups {
+		rules[g.User] = append(rules[g.User], g)
+	}
+	return &mockRuleStore{rules: rules}
+}
+
+func (m *mockRuleStore) Open(_ context.Context) error {
+	return m.openErr
+}
+
+func (m *mockRuleStore) ListAllRules(_ context.Context) (map[string][]*RuleGroup, error) {
+	if m.listErr != nil {
+		return nil, m.listErr
+	}
+	return m.rules, nil
+}
+
+// defaultRulerConfig returns a RulerConfig suitable for tests: a single
+// instance named "localhost", 128 tokens, a 5s heartbeat period and a 1m
+// heartbeat timeout. The
+// returned cleanup function is a placeholder for callers that `defer` it;
+// tests that need a tokens file create their own via t.TempDir(). The
+// RuleStore a Ruler uses is independent of its config, so it's supplied
+// separately to newRuler/newRulerWithStore, not here.
+func defaultRulerConfig(t *testing.T) (RulerConfig, func()) {
+	t.Helper()
+
+	cfg := RulerConfig{}
+	cfg.Ring.InstanceID = "localhost"
+	cfg.Ring.InstanceAddr = "localhost"
+	cfg.Ring.InstancePort = 0
+	cfg.Ring.NumTokens = 128
+	cfg.Ring.HeartbeatPeriod = 5 * time.Second
+	cfg.Ring.HeartbeatTimeout = time.Minute
+
+	return cfg, func() {}
+}
+
+// newRuler builds a Ruler for tests from cfg as given; it doesn't set up the
+// ring. Callers that want a ring-backed ruler should set cfg.EnableSharding
+// and call enableSharding themselves with a test KV client.
+func newRuler(t *testing.T, cfg RulerConfig) (*Ruler, func()) {
+	t.Helper()
+
+	return newRulerWithStore(t, cfg, newMockRuleStore(mockRules))
+}
+
+// newRulerWithStore is like newRuler but lets the caller supply the
+// RuleStore, so tests can inject failures via a mockRuleStore with openErr
+// or listErr set.
+func newRulerWithStore(t *testing.T, cfg RulerConfig, store RuleStore) (*Ruler, func()) {
+	t.Helper()
+
+	return newRulerWithStoreAndLimits(t, cfg, store, nil)
+}
+
+// mockLimits is a Limits implementation backed by a fixed per-tenant map,
+// for tests that exercise the shard-size override path; a tenant absent
+// from shardSizes returns 0, falling back to RulerConfig.RulerTenantShardSize.
+type mockLimits struct {
+	shardSizes map[string]int
+}
+
+func (m *mockLimits) RulerTenantShardSize(userID string) int {
+	return m.shardSizes[userID]
+}
+
+// newRulerWithStoreAndLimits is like newRulerWithStore but also lets the
+// caller supply a Limits, so tests can exercise per-tenant shard-size
+// overrides.
+func newRulerWithStoreAndLimits(t *testing.T, cfg RulerConfig, store RuleStore, limits Limits) (*Ruler, func()) {
+	t.Helper()
+
+	r, err := NewRuler(cfg, store, limits, log.NewNopLogger(), nil)
+	require.NoError(t, err)
+
+	return r, func() {}
+}
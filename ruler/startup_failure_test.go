@@ -0,0 +1,106 @@
+package ruler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/dskit/kv/consul"
+	"github.com/grafana/dskit/ring"
+	"github.com/grafana/dskit/services"
+	"github.com/grafana/dskit/testutil"
+)
+
+// TestRulerStartupFailure_RollsBackLifecycler injects a failure at each phase
+// of starting() in turn and asserts that (a) the ruler service ends up
+// Failed, (b) the ring KV is left with no trace of the ruler: a half
+// initialized ruler must not linger as a ghost ring entry, and (c), for a
+// failure that happens after the ring subservices are already running, that
+// the read-only ring poller is actually stopped too rather than leaked.
+func TestRulerStartupFailure_RollsBackLifecycler(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		failure func(r *Ruler, store *mockRuleStore)
+	}{
+		{
+			name: "rule store open fails",
+			failure: func(_ *Ruler, store *mockRuleStore) {
+				store.openErr = errors.New("failed to open rule store")
+			},
+		},
+		{
+			name: "sub-services manager start fails",
+			failure: func(r *Ruler, _ *mockRuleStore) {
+				failing := services.NewBasicService(func(context.Context) error {
+					return errors.New("sub-service failed to start")
+				}, func(context.Context) error {
+					<-make(chan struct{})
+					return nil
+				}, nil)
+
+				manager, err := services.NewManager(r.lifecycler, failing)
+				require.NoError(t, err)
+				r.subservices = manager
+				r.subservicesWatcher = services.NewFailureWatcher()
+				r.subservicesWatcher.WatchManager(r.subservices)
+			},
+		},
+		{
+			name: "initial sharding sync fails",
+			failure: func(_ *Ruler, store *mockRuleStore) {
+				store.listErr = errors.New("failed to list rule groups")
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			config, cleanup := defaultRulerConfig(t)
+			defer cleanup()
+
+			store := newMockRuleStore(mockRules)
+			r, rcleanup := newRulerWithStore(t, config, store)
+			defer rcleanup()
+
+			r.cfg.EnableSharding = true
+			ringStore, closer := consul.NewInMemoryClient(ring.GetCodec(), log.NewNopLogger())
+			t.Cleanup(func() { assert.NoError(t, closer.Close()) })
+
+			require.NoError(t, enableSharding(r, ringStore))
+
+			tc.failure(r, store)
+
+			require.Error(t, services.StartAndAwaitRunning(ctx, r))
+			require.Equal(t, services.Failed, r.State())
+
+			// The ruler must be gone from the ring: no tokens, no instance
+			// entry for its ID.
+			testutil.Poll(t, time.Second, true, func() interface{} {
+				d, err := ringStore.Get(ctx, ring.RulerRingKey)
+				if err != nil {
+					return false
+				}
+
+				desc := ring.GetOrCreateRingDesc(d)
+				_, ok := desc.Ingesters[config.Ring.InstanceID]
+				return !ok
+			})
+
+			if tc.name == "initial sharding sync fails" {
+				// The ring subservices (lifecycler and read-only ring
+				// poller) were already running when syncRules failed, so
+				// rolling back must stop the whole manager, not just the
+				// lifecycler — otherwise r.ring keeps polling forever with
+				// nothing left alive to stop it.
+				testutil.Poll(t, time.Second, services.Terminated, func() interface{} {
+					return r.ring.State()
+				})
+			}
+		})
+	}
+}